@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// aclRule is a single per-chat authorization rule loaded from
+// TELEGRAM_BOT_ACL.
+type aclRule struct {
+	ChatID        int64    `json:"chatId"`
+	RequireAdmin  bool     `json:"requireAdmin,omitempty"`
+	AllowCommands []string `json:"allowCommands,omitempty"`
+}
+
+// Authorizer generalizes the flat allowedUserIDs/allowedUserNames gate
+// into per-chat rules: restricting to specific chat IDs, requiring the
+// sender to be a chat admin, and/or restricting to an allowlist of
+// command prefixes.
+type Authorizer struct {
+	bot   *telegram.BotAPI
+	rules map[int64]aclRule
+}
+
+// NewAuthorizer builds an Authorizer from a TELEGRAM_BOT_ACL JSON array
+// of aclRule, e.g. `[{"chatId":-100123,"requireAdmin":true}]`. An empty
+// acl disables per-chat rules entirely, leaving the global
+// allowedUserIDs/allowedUserNames gate as the only check.
+func NewAuthorizer(bot *telegram.BotAPI, acl string) (*Authorizer, error) {
+	a := &Authorizer{bot: bot, rules: make(map[int64]aclRule)}
+	if acl == "" {
+		return a, nil
+	}
+
+	var rules []aclRule
+	if err := json.Unmarshal([]byte(acl), &rules); err != nil {
+		return nil, fmt.Errorf("invalid TELEGRAM_BOT_ACL: %w", err)
+	}
+	for _, rule := range rules {
+		a.rules[rule.ChatID] = rule
+	}
+
+	return a, nil
+}
+
+// Authorize reports whether user may act on command (empty for plain
+// messages) in chatID. A chat with a matching aclRule grants access on its
+// own, independent of the global allowedUserIDs/allowedUserNames gate,
+// narrowed by that rule's RequireAdmin/AllowCommands; chats with no rule
+// fall back to the global gate.
+func (a *Authorizer) Authorize(user *telegram.User, chatID int64, command string) bool {
+	if user == nil {
+		return false
+	}
+
+	rule, ok := a.rules[chatID]
+	if !ok {
+		return isAuthorized(user)
+	}
+
+	if len(rule.AllowCommands) > 0 && !slices.Contains(rule.AllowCommands, command) {
+		return false
+	}
+
+	if rule.RequireAdmin && !a.isChatAdmin(chatID, user.ID) {
+		return false
+	}
+
+	return true
+}
+
+func (a *Authorizer) isChatAdmin(chatID, userID int64) bool {
+	member, err := a.bot.GetChatMember(telegram.GetChatMemberConfig{
+		ChatConfigWithUser: telegram.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		slog.Error("Failed to verify chat admin", "chatID", chatID, "userID", userID, "error", err)
+		return false
+	}
+
+	return member.IsAdministrator() || member.IsCreator()
+}
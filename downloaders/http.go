@@ -0,0 +1,35 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+)
+
+// fetchDirect fetches url directly over HTTP, for the simple case where
+// the URL already points straight at a media file rather than a page
+// that yt-dlp would need to extract from.
+func fetchDirect(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("unexpected status %s fetching %s", resp.Status, url)
+	}
+
+	name := path.Base(req.URL.Path)
+	if name == "" || name == "." || name == "/" {
+		name = "download"
+	}
+
+	return resp.Body, name, nil
+}
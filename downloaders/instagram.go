@@ -0,0 +1,35 @@
+package downloaders
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"regexp"
+)
+
+var instagramURLRe = regexp.MustCompile(`^https?://(www\.)?instagram\.com/(p|reel|tv)/`)
+
+// Instagram downloads posts and reels from instagram.com links via
+// yt-dlp, falling back to a direct HTTP fetch when yt-dlp isn't
+// installed.
+type Instagram struct{}
+
+func NewInstagram() *Instagram {
+	return &Instagram{}
+}
+
+func (i *Instagram) Name() string {
+	return "instagram"
+}
+
+func (i *Instagram) Match(url string) bool {
+	return instagramURLRe.MatchString(url)
+}
+
+func (i *Instagram) Fetch(ctx context.Context, url string) (io.ReadCloser, string, string, error) {
+	rc, name, err := fetchVideo(ctx, url)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return rc, name, mimeForExt(filepath.Ext(name)), nil
+}
@@ -0,0 +1,10 @@
+package downloaders
+
+import "mime"
+
+func mimeForExt(ext string) string {
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
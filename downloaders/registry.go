@@ -0,0 +1,53 @@
+package downloaders
+
+import (
+	"fmt"
+	"strings"
+)
+
+var builtins = map[string]func() Responder{
+	"youtube":   func() Responder { return NewYouTube() },
+	"tiktok":    func() Responder { return NewTikTok() },
+	"instagram": func() Responder { return NewInstagram() },
+}
+
+// Registry holds the set of Responders enabled for this bot instance.
+type Registry struct {
+	responders []Responder
+}
+
+// NewRegistry builds a Registry from a comma-separated list of downloader
+// names, e.g. the value of TELEGRAM_BOT_DOWNLOADERS. An empty names
+// string disables all downloaders: operators must opt in explicitly,
+// since enabling downloaders means the bot shells out to yt-dlp against
+// attacker-influenced URLs.
+func NewRegistry(names string) (*Registry, error) {
+	names = strings.TrimSpace(names)
+	reg := &Registry{}
+	if names == "" {
+		return reg, nil
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		newResponder, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown downloader %q", name)
+		}
+		reg.responders = append(reg.responders, newResponder())
+	}
+	return reg, nil
+}
+
+// Match returns the first Responder able to handle url, if any.
+func (r *Registry) Match(url string) (Responder, bool) {
+	for _, resp := range r.responders {
+		if resp.Match(url) {
+			return resp, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,21 @@
+// Package downloaders provides pluggable fetchers for media shared via
+// URL in Telegram messages (YouTube, TikTok, Instagram, ...), so obot
+// agents can reason over shared links without a separate scraping tool.
+package downloaders
+
+import (
+	"context"
+	"io"
+)
+
+// Responder knows how to recognize and download media from URLs for a
+// single source platform.
+type Responder interface {
+	// Name identifies the platform this Responder handles, e.g. "youtube".
+	Name() string
+	// Match reports whether this Responder can handle the given URL.
+	Match(url string) bool
+	// Fetch downloads the media at url, returning its content, a
+	// suggested filename and its MIME type. Callers must close rc.
+	Fetch(ctx context.Context, url string) (rc io.ReadCloser, filename string, mimeType string, err error)
+}
@@ -0,0 +1,34 @@
+package downloaders
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"regexp"
+)
+
+var tiktokURLRe = regexp.MustCompile(`^https?://(www\.|vm\.|vt\.)?tiktok\.com/`)
+
+// TikTok downloads videos from tiktok.com links via yt-dlp, falling back
+// to a direct HTTP fetch when yt-dlp isn't installed.
+type TikTok struct{}
+
+func NewTikTok() *TikTok {
+	return &TikTok{}
+}
+
+func (t *TikTok) Name() string {
+	return "tiktok"
+}
+
+func (t *TikTok) Match(url string) bool {
+	return tiktokURLRe.MatchString(url)
+}
+
+func (t *TikTok) Fetch(ctx context.Context, url string) (io.ReadCloser, string, string, error) {
+	rc, name, err := fetchVideo(ctx, url)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return rc, name, mimeForExt(filepath.Ext(name)), nil
+}
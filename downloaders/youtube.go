@@ -0,0 +1,35 @@
+package downloaders
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"regexp"
+)
+
+var youtubeURLRe = regexp.MustCompile(`^https?://(www\.)?(youtube\.com/(watch\?|shorts/)|youtu\.be/)`)
+
+// YouTube downloads videos from youtube.com and youtu.be links via
+// yt-dlp, falling back to a direct HTTP fetch when yt-dlp isn't
+// installed.
+type YouTube struct{}
+
+func NewYouTube() *YouTube {
+	return &YouTube{}
+}
+
+func (y *YouTube) Name() string {
+	return "youtube"
+}
+
+func (y *YouTube) Match(url string) bool {
+	return youtubeURLRe.MatchString(url)
+}
+
+func (y *YouTube) Fetch(ctx context.Context, url string) (io.ReadCloser, string, string, error) {
+	rc, name, err := fetchVideo(ctx, url)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return rc, name, mimeForExt(filepath.Ext(name)), nil
+}
@@ -0,0 +1,73 @@
+package downloaders
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// fetchVideo downloads url via yt-dlp when the binary is available, and
+// falls back to a direct HTTP fetch otherwise. The fallback only succeeds
+// for URLs that point straight at a media file rather than a page that
+// needs extraction, but it means a deployment without yt-dlp installed
+// still handles the simple cases instead of failing every link.
+func fetchVideo(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	if _, err := exec.LookPath("yt-dlp"); err != nil {
+		return fetchDirect(ctx, url)
+	}
+
+	f, name, err := fetchWithYtDlp(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, name, nil
+}
+
+// fetchWithYtDlp downloads url into a temp directory via the yt-dlp CLI
+// and returns the resulting file opened for reading. The caller is
+// responsible for closing the returned file; the backing temp directory
+// is removed once it is closed.
+func fetchWithYtDlp(ctx context.Context, url string) (*tempFile, string, error) {
+	dir, err := os.MkdirTemp("", "obot-telegram-dl-*")
+	if err != nil {
+		return nil, "", err
+	}
+
+	outTemplate := filepath.Join(dir, "%(id)s.%(ext)s")
+	cmd := exec.CommandContext(ctx, "yt-dlp", "-o", outTemplate, "--no-playlist", url)
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("yt-dlp failed for %s: %w", url, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("yt-dlp produced no output for %s", url)
+	}
+
+	name := entries[0].Name()
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+
+	return &tempFile{File: f, dir: dir}, name, nil
+}
+
+// tempFile closes its backing file and removes the temp directory it
+// lives in, so yt-dlp output never lingers on disk.
+type tempFile struct {
+	*os.File
+	dir string
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.RemoveAll(t.dir)
+	return err
+}
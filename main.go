@@ -1,23 +1,43 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/iwilltry42/obot-telegram/downloaders"
+	"github.com/iwilltry42/obot-telegram/queue"
 
 	telegram "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
 	"github.com/gptscript-ai/go-gptscript"
 )
 
+const defaultCacheMaxBytes = 64 << 20 // 64MiB
+
+const defaultRateLimit = "10-M"
+
+const defaultDataPath = "telegram-bot.db"
+
+// messageBatchSize caps how many queued messages a single /message poll
+// pops and acknowledges at once.
+const messageBatchSize = 10
+
+var fileIDPathRe = regexp.MustCompile(`^/fileid/([^/.]+)\.([a-zA-Z0-9]+)$`)
+
 func exitError(err error) {
 	fmt.Printf("telegram bot tool failed: %v\n", err)
 	os.Exit(1)
@@ -26,7 +46,6 @@ func exitError(err error) {
 var (
 	allowedUserIDs   = map[int64]struct{}{}
 	allowedUserNames = map[string]struct{}{}
-	messageQueue     = make(chan Message, 100)
 )
 
 func isAuthorized(user *telegram.User) bool {
@@ -52,6 +71,51 @@ type Message struct {
 	VoiceURL string `json:"voiceURL,omitempty"`
 	ImageURL string `json:"imageURL,omitempty"`
 	FileExt  string `json:"fileExt,omitempty"`
+
+	// ParseMode is one of "Markdown", "MarkdownV2" or "HTML".
+	ParseMode             string           `json:"parseMode,omitempty"`
+	DisableWebPagePreview bool             `json:"disableWebPagePreview,omitempty"`
+	PhotoPath             string           `json:"photoPath,omitempty"`
+	DocumentPath          string           `json:"documentPath,omitempty"`
+	VoicePath             string           `json:"voicePath,omitempty"`
+	Caption               string           `json:"caption,omitempty"`
+	ReplyMarkup           [][]InlineButton `json:"replyMarkup,omitempty"`
+	// EditMsgID, when set, edits the referenced message instead of sending
+	// a new one.
+	EditMsgID string `json:"editMsgId,omitempty"`
+	// CallbackData carries a pressed inline keyboard button's data on
+	// inbound messages produced from a CallbackQuery.
+	CallbackData string `json:"callbackData,omitempty"`
+	// Command and Args are populated for inbound messages that start with
+	// a Telegram bot command, e.g. "/ask something" becomes Command "ask",
+	// Args "something".
+	Command string `json:"command,omitempty"`
+	Args    string `json:"args,omitempty"`
+}
+
+// InlineButton is a single inline keyboard button that answers via a
+// CallbackQuery carrying CallbackData.
+type InlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callbackData"`
+}
+
+func buildReplyMarkup(rows [][]InlineButton) *telegram.InlineKeyboardMarkup {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	keyboard := make([][]telegram.InlineKeyboardButton, 0, len(rows))
+	for _, row := range rows {
+		buttons := make([]telegram.InlineKeyboardButton, 0, len(row))
+		for _, btn := range row {
+			buttons = append(buttons, telegram.NewInlineKeyboardButtonData(btn.Text, btn.CallbackData))
+		}
+		keyboard = append(keyboard, buttons)
+	}
+
+	markup := telegram.NewInlineKeyboardMarkup(keyboard...)
+	return &markup
 }
 
 func uploadToWs(ctx context.Context, gClient *gptscript.GPTScript, url string, ext string) (string, error) {
@@ -77,6 +141,75 @@ func uploadToWs(ctx context.Context, gClient *gptscript.GPTScript, url string, e
 
 }
 
+func uploadReaderToWs(ctx context.Context, gClient *gptscript.GPTScript, r io.Reader, ext string) (string, error) {
+	path := uuid.NewString() + ext
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return path, err
+	}
+
+	if err := gClient.WriteFileInWorkspace(ctx, path, b); err != nil {
+		return path, err
+	}
+
+	return path, nil
+}
+
+// extractURLs returns the URLs found in a message's text/caption entities,
+// correcting for the fact that Telegram entity offsets and lengths are
+// counted in UTF-16 code units rather than bytes or runes.
+func extractURLs(msg *telegram.Message) []string {
+	if msg == nil {
+		return nil
+	}
+
+	text := msg.Text
+	entities := msg.Entities
+	if text == "" {
+		text = msg.Caption
+		entities = msg.CaptionEntities
+	}
+	if text == "" || len(entities) == 0 {
+		return nil
+	}
+
+	utf16Text := utf16.Encode([]rune(text))
+
+	var urls []string
+	for _, e := range entities {
+		switch e.Type {
+		case "url":
+			start, end := e.Offset, e.Offset+e.Length
+			if start < 0 || end > len(utf16Text) || start > end {
+				continue
+			}
+			urls = append(urls, string(utf16.Decode(utf16Text[start:end])))
+		case "text_link":
+			if e.URL != "" {
+				urls = append(urls, e.URL)
+			}
+		}
+	}
+
+	return urls
+}
+
+// messageMentionsBot reports whether msg's text contains an @mention of
+// botUserName.
+func messageMentionsBot(msg *telegram.Message, botUserName string) bool {
+	if botUserName == "" {
+		return false
+	}
+	return strings.Contains(msg.Text, "@"+botUserName)
+}
+
+// repliesToBot reports whether msg is a reply to a message sent by the
+// bot account identified by botUserID.
+func repliesToBot(msg *telegram.Message, botUserID int64) bool {
+	return msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == botUserID
+}
+
 func main() {
 	bot, err := telegram.NewBotAPI(os.Getenv("TELEGRAM_BOT_TOKEN"))
 	if err != nil {
@@ -108,46 +241,106 @@ func main() {
 		allowedUserNames[u] = struct{}{}
 	}
 
+	cacheMaxBytes := int64(defaultCacheMaxBytes)
+	if v := os.Getenv("TELEGRAM_BOT_CACHE_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			exitError(fmt.Errorf("invalid TELEGRAM_BOT_CACHE_MAX_BYTES: %v", v))
+		}
+		cacheMaxBytes = n
+	}
+	cache := newMediaCache(cacheMaxBytes)
+
+	rateLimitSpec := defaultRateLimit
+	if v := os.Getenv("TELEGRAM_BOT_RATE_LIMIT"); v != "" {
+		rateLimitSpec = v
+	}
+	limiter, err := newIPRateLimiter(rateLimitSpec)
+	if err != nil {
+		exitError(fmt.Errorf("invalid TELEGRAM_BOT_RATE_LIMIT: %w", err))
+	}
+
+	dlRegistry, err := downloaders.NewRegistry(os.Getenv("TELEGRAM_BOT_DOWNLOADERS"))
+	if err != nil {
+		exitError(fmt.Errorf("invalid TELEGRAM_BOT_DOWNLOADERS: %w", err))
+	}
+
+	authorizer, err := NewAuthorizer(bot, os.Getenv("TELEGRAM_BOT_ACL"))
+	if err != nil {
+		exitError(err)
+	}
+
+	dataPath := os.Getenv("TELEGRAM_BOT_DATA_PATH")
+	if dataPath == "" {
+		dataPath = defaultDataPath
+	}
+	mq, err := queue.Open(dataPath)
+	if err != nil {
+		exitError(fmt.Errorf("failed to open message queue: %w", err))
+	}
+	defer mq.Close()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("http://127.0.0.1:" + os.Getenv("PORT")))
 	})
 	mux.HandleFunc("/message", func(w http.ResponseWriter, r *http.Request) {
-		// read Message from the queue
-		for {
-			select {
-			case msg := <-messageQueue:
-				slog.Info("Found Message", "Message", msg)
-				if msg.VoiceURL != "" {
-					voiceID, err := uploadToWs(r.Context(), gClient, msg.VoiceURL, msg.FileExt)
-					if err != nil {
-						slog.Error("Failed to upload voice file", "error", err)
-						http.Error(w, "Failed to upload voice file", http.StatusInternalServerError)
-						return
-					}
-					msg.Text = fmt.Sprintf("<INFO>This message contains a voice file which you can find in the workspace at %s<INFO>\n<MESSAGE>%s</MESSAGE>", voiceID, msg)
-				} else if msg.ImageURL != "" {
-					imageID, err := uploadToWs(r.Context(), gClient, msg.ImageURL, msg.FileExt)
-					if err != nil {
-						slog.Error("Failed to upload image file", "error", err)
-						http.Error(w, "Failed to upload image file", http.StatusInternalServerError)
-						return
-					}
-					msg.Text = fmt.Sprintf("<INFO>This message contains an image file which you can find in the workspace at %s<INFO>\n<MESSAGE>%s</MESSAGE>", imageID, msg)
-				}
+		items, ack, err := mq.Dequeue(r.Context(), messageBatchSize)
+		if err != nil {
+			slog.Error("Failed to dequeue messages", "error", err)
+			http.Error(w, "Failed to dequeue messages", http.StatusInternalServerError)
+			return
+		}
+		if len(items) == 0 {
+			_, _ = w.Write([]byte("No messages\n"))
+			return
+		}
 
-				msgBytes, err := json.Marshal(msg)
+		msgs := make([]Message, 0, len(items))
+		for _, item := range items {
+			var msg Message
+			if err := json.Unmarshal(item.Payload, &msg); err != nil {
+				slog.Error("Failed to unmarshal queued message", "error", err)
+				continue
+			}
+			slog.Info("Found Message", "Message", msg)
+
+			if msg.VoiceURL != "" {
+				voiceID, err := uploadToWs(r.Context(), gClient, msg.VoiceURL, msg.FileExt)
 				if err != nil {
-					slog.Error("Failed to marshal message", "error", err)
-					http.Error(w, "Failed to marshal message", http.StatusInternalServerError)
+					slog.Error("Failed to upload voice file", "error", err)
+					http.Error(w, "Failed to upload voice file", http.StatusInternalServerError)
 					return
 				}
-
-				_, _ = w.Write(msgBytes)
-			default:
-				_, _ = w.Write([]byte("No messages\n"))
-				return
+				msg.Text = fmt.Sprintf("<INFO>This message contains a voice file which you can find in the workspace at %s<INFO>\n<MESSAGE>%s</MESSAGE>", voiceID, msg)
+			} else if msg.ImageURL != "" {
+				imageID, err := uploadToWs(r.Context(), gClient, msg.ImageURL, msg.FileExt)
+				if err != nil {
+					slog.Error("Failed to upload image file", "error", err)
+					http.Error(w, "Failed to upload image file", http.StatusInternalServerError)
+					return
+				}
+				msg.Text = fmt.Sprintf("<INFO>This message contains an image file which you can find in the workspace at %s<INFO>\n<MESSAGE>%s</MESSAGE>", imageID, msg)
 			}
+
+			msgs = append(msgs, msg)
+		}
+
+		msgBytes, err := json.Marshal(msgs)
+		if err != nil {
+			slog.Error("Failed to marshal messages", "error", err)
+			http.Error(w, "Failed to marshal messages", http.StatusInternalServerError)
+			return
+		}
+
+		// Only acknowledge once the response has actually been written, so a
+		// failed delivery leaves the messages queued for redelivery.
+		if _, err := w.Write(msgBytes); err != nil {
+			slog.Error("Failed to write message response", "error", err)
+			return
+		}
+		if err := ack(); err != nil {
+			slog.Error("Failed to acknowledge messages", "error", err)
 		}
 	})
 
@@ -173,27 +366,148 @@ func main() {
 			return
 		}
 
-		// send the Message
-		msg := telegram.NewMessage(chatID, req.Text)
+		markup := buildReplyMarkup(req.ReplyMarkup)
+
+		var chattable telegram.Chattable
+		switch {
+		case req.EditMsgID != "":
+			msgID, err := strconv.Atoi(req.EditMsgID)
+			if err != nil {
+				slog.Error("Invalid Edit Message ID", "EditMsgID", req.EditMsgID)
+				http.Error(w, "Invalid Edit Message ID", http.StatusBadRequest)
+				return
+			}
+			edit := telegram.NewEditMessageText(chatID, msgID, req.Text)
+			edit.ParseMode = req.ParseMode
+			edit.ReplyMarkup = markup
+			edit.DisableWebPagePreview = req.DisableWebPagePreview
+			chattable = edit
+
+		case req.PhotoPath != "":
+			b, err := gClient.ReadFileInWorkspace(r.Context(), req.PhotoPath)
+			if err != nil {
+				slog.Error("Failed to read photo from workspace", "path", req.PhotoPath, "error", err)
+				http.Error(w, "Failed to read photo from workspace", http.StatusInternalServerError)
+				return
+			}
+			photo := telegram.NewPhoto(chatID, telegram.FileReader{Name: filepath.Base(req.PhotoPath), Reader: bytes.NewReader(b)})
+			photo.Caption = req.Caption
+			photo.ParseMode = req.ParseMode
+			if markup != nil {
+				photo.ReplyMarkup = *markup
+			}
+			chattable = photo
+
+		case req.DocumentPath != "":
+			b, err := gClient.ReadFileInWorkspace(r.Context(), req.DocumentPath)
+			if err != nil {
+				slog.Error("Failed to read document from workspace", "path", req.DocumentPath, "error", err)
+				http.Error(w, "Failed to read document from workspace", http.StatusInternalServerError)
+				return
+			}
+			doc := telegram.NewDocument(chatID, telegram.FileReader{Name: filepath.Base(req.DocumentPath), Reader: bytes.NewReader(b)})
+			doc.Caption = req.Caption
+			doc.ParseMode = req.ParseMode
+			if markup != nil {
+				doc.ReplyMarkup = *markup
+			}
+			chattable = doc
 
-		if req.MsgID != "" {
-			msgID, err := strconv.Atoi(req.MsgID)
+		case req.VoicePath != "":
+			b, err := gClient.ReadFileInWorkspace(r.Context(), req.VoicePath)
 			if err != nil {
-				slog.Error("Invalid Message ID", "MsgID", req.MsgID)
-				http.Error(w, "Invalid Message ID", http.StatusBadRequest)
+				slog.Error("Failed to read voice from workspace", "path", req.VoicePath, "error", err)
+				http.Error(w, "Failed to read voice from workspace", http.StatusInternalServerError)
 				return
 			}
-			msg.ReplyToMessageID = msgID
+			voice := telegram.NewVoice(chatID, telegram.FileReader{Name: filepath.Base(req.VoicePath), Reader: bytes.NewReader(b)})
+			voice.Caption = req.Caption
+			voice.ParseMode = req.ParseMode
+			if markup != nil {
+				voice.ReplyMarkup = *markup
+			}
+			chattable = voice
+
+		default:
+			msg := telegram.NewMessage(chatID, req.Text)
+			msg.ParseMode = req.ParseMode
+			msg.DisableWebPagePreview = req.DisableWebPagePreview
+			if markup != nil {
+				msg.ReplyMarkup = *markup
+			}
+			if req.MsgID != "" {
+				msgID, err := strconv.Atoi(req.MsgID)
+				if err != nil {
+					slog.Error("Invalid Message ID", "MsgID", req.MsgID)
+					http.Error(w, "Invalid Message ID", http.StatusBadRequest)
+					return
+				}
+				msg.ReplyToMessageID = msgID
+			}
+			chattable = msg
 		}
-		_, err = bot.Send(msg)
-		if err != nil {
+
+		if _, err := bot.Send(chattable); err != nil {
+			slog.Error("Failed to send Message", "error", err)
 			http.Error(w, "Failed to send Message", http.StatusInternalServerError)
 			return
 		}
 	})
 
+	mux.HandleFunc("/fileid/", func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.allow(remoteIP(r)) {
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		m := fileIDPathRe.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			http.Error(w, "Invalid file path", http.StatusBadRequest)
+			return
+		}
+		fileID, ext := m[1], m[2]
+
+		if data, contentType, ok := cache.get(fileID); ok {
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write(data)
+			return
+		}
+
+		f, err := bot.GetFile(telegram.FileConfig{FileID: fileID})
+		if err != nil {
+			slog.Error("Failed to get file", "fileID", fileID, "error", err)
+			http.Error(w, "Failed to resolve file", http.StatusBadGateway)
+			return
+		}
+
+		resp, err := http.Get(f.Link(bot.Token))
+		if err != nil {
+			slog.Error("Failed to fetch file", "fileID", fileID, "error", err)
+			http.Error(w, "Failed to fetch file", http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			slog.Error("Failed to read file", "fileID", fileID, "error", err)
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+
+		contentType := mime.TypeByExtension("." + ext)
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		cache.set(fileID, data, contentType)
+
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(data)
+	})
+
+	addr := "127.0.0.1:" + os.Getenv("PORT")
 	httpServer := &http.Server{
-		Addr:    "127.0.0.1:" + os.Getenv("PORT"),
+		Addr:    addr,
 		Handler: mux,
 	}
 
@@ -201,62 +515,228 @@ func main() {
 
 	slog.Info("Authorized on account", "account", bot.Self.UserName)
 
-	u := telegram.NewUpdate(0)
-	u.Timeout = 60
+	var idleTimeout time.Duration
+	if v := os.Getenv("TELEGRAM_BOT_IDLE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			exitError(fmt.Errorf("invalid TELEGRAM_BOT_IDLE_TIMEOUT: %w", err))
+		}
+		idleTimeout = d
+	}
+	idle := newIdleShutdown(idleTimeout, func() {
+		slog.Info("Idle timeout reached, shutting down", "timeout", idleTimeout)
+		_ = httpServer.Shutdown(context.Background())
+	})
 
-	updates := bot.GetUpdatesChan(u)
+	mode := os.Getenv("TELEGRAM_BOT_MODE")
+	if mode == "" {
+		mode = "polling"
+	}
 
-	slog.Info("Telegram bot started")
-	go func() {
-		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			exitError(err)
+	switch mode {
+	case "webhook":
+		publicURL := os.Getenv("TELEGRAM_BOT_PUBLIC_URL")
+		if publicURL == "" {
+			exitError(fmt.Errorf("TELEGRAM_BOT_MODE=webhook requires TELEGRAM_BOT_PUBLIC_URL"))
 		}
-	}()
 
-	for update := range updates {
-		if update.Message == nil {
-			continue
+		webhookPath := "/bot" + bot.Token
+
+		var wh telegram.WebhookConfig
+		if cert := os.Getenv("TELEGRAM_BOT_TLS_CERT"); cert != "" {
+			wh, err = telegram.NewWebhookWithCert(publicURL+webhookPath, telegram.FilePath(cert))
+		} else {
+			wh, err = telegram.NewWebhook(publicURL + webhookPath)
+		}
+		if err != nil {
+			exitError(fmt.Errorf("failed to build webhook config: %w", err))
+		}
+		if _, err := bot.Request(wh); err != nil {
+			exitError(fmt.Errorf("failed to register webhook: %w", err))
 		}
 
-		user := update.SentFrom()
-		if !isAuthorized(user) {
-			slog.Warn("Unauthorized user", "userID", user.ID, "userName", user.UserName)
-			continue
+		mux.HandleFunc(webhookPath, func(w http.ResponseWriter, r *http.Request) {
+			idle.reset(idleTimeout)
+
+			update, err := bot.HandleUpdate(r)
+			if err != nil {
+				slog.Error("Failed to parse webhook update", "error", err)
+				http.Error(w, "Failed to parse webhook update", http.StatusBadRequest)
+				return
+			}
+			handleUpdate(bot, gClient, dlRegistry, mq, authorizer, *update)
+		})
+
+		slog.Info("Telegram bot started", "mode", "webhook")
+	case "polling":
+		offset, err := mq.LastOffset()
+		if err != nil {
+			exitError(fmt.Errorf("failed to read last update offset: %w", err))
 		}
 
-		slog.Info("Received a Message", "Message", update.Message.Text, "from", user)
-		m := Message{
-			ChatID: fmt.Sprintf("%d", update.Message.Chat.ID),
-			MsgID:  fmt.Sprintf("%d", update.Message.MessageID),
-			Text:   update.Message.Text,
-			User:   fmt.Sprintf("%s %s (%s)", user.FirstName, user.LastName, user.UserName),
+		u := telegram.NewUpdate(offset)
+		u.Timeout = 60
+
+		updates := bot.GetUpdatesChan(u)
+
+		slog.Info("Telegram bot started", "mode", "polling")
+		go func() {
+			for update := range updates {
+				idle.reset(idleTimeout)
+				handleUpdate(bot, gClient, dlRegistry, mq, authorizer, update)
+				if err := mq.SetLastOffset(update.UpdateID + 1); err != nil {
+					slog.Error("Failed to persist update offset", "error", err)
+				}
+			}
+		}()
+	default:
+		exitError(fmt.Errorf("invalid TELEGRAM_BOT_MODE: %v", mode))
+	}
+
+	ln, err := listen(addr)
+	if err != nil {
+		exitError(fmt.Errorf("failed to open listener: %w", err))
+	}
+
+	if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		exitError(err)
+	}
+}
+
+// handleUpdate processes a single Telegram update, enqueueing a Message for
+// the /message consumer. It is shared by both polling and webhook mode.
+func handleUpdate(bot *telegram.BotAPI, gClient *gptscript.GPTScript, dlRegistry *downloaders.Registry, mq queue.Queue, authorizer *Authorizer, update telegram.Update) {
+	if update.CallbackQuery != nil {
+		handleCallbackQuery(bot, mq, authorizer, update.CallbackQuery)
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
+
+	user := update.SentFrom()
+	chatID := update.Message.Chat.ID
+
+	var command, args string
+	if update.Message.IsCommand() {
+		command = update.Message.Command()
+		args = update.Message.CommandArguments()
+	}
+
+	if !authorizer.Authorize(user, chatID, command) {
+		slog.Warn("Unauthorized user", "userID", user.ID, "userName", user.UserName, "chatID", chatID)
+		return
+	}
+
+	// In group chats, only react to messages that mention the bot or reply
+	// to one of its messages, so the bot doesn't forward every message in
+	// a shared group to the LLM backend.
+	if !update.Message.Chat.IsPrivate() && !messageMentionsBot(update.Message, bot.Self.UserName) && !repliesToBot(update.Message, bot.Self.ID) {
+		return
+	}
+
+	slog.Info("Received a Message", "Message", update.Message.Text, "from", user)
+	m := Message{
+		ChatID:  fmt.Sprintf("%d", chatID),
+		MsgID:   fmt.Sprintf("%d", update.Message.MessageID),
+		Text:    update.Message.Text,
+		User:    fmt.Sprintf("%s %s (%s)", user.FirstName, user.LastName, user.UserName),
+		Command: command,
+		Args:    args,
+	}
+
+	if update.Message.Voice != nil {
+		slog.Info("Received a Voice Message", "Voice", update.Message.Voice)
+		f, err := bot.GetFile(telegram.FileConfig{FileID: update.Message.Voice.FileID})
+		if err != nil {
+			slog.Error("Failed to get Voice URL", "error", err)
+			return
 		}
+		m.VoiceURL = f.Link(bot.Token)
+		m.FileExt = filepath.Ext(f.FilePath)
 
-		if update.Message.Voice != nil {
-			slog.Info("Received a Voice Message", "Voice", update.Message.Voice)
-			f, err := bot.GetFile(telegram.FileConfig{FileID: update.Message.Voice.FileID})
-			if err != nil {
-				slog.Error("Failed to get Voice URL", "error", err)
+	}
+
+	if update.Message.Photo != nil {
+		slog.Info("Received a Photo Message", "Photo", update.Message.Photo)
+		f, err := bot.GetFile(telegram.FileConfig{FileID: update.Message.Photo[0].FileID})
+		if err != nil {
+			slog.Error("Failed to get Photo URL", "error", err)
+			return
+		}
+		m.ImageURL = f.Link(bot.Token)
+		m.FileExt = filepath.Ext(f.FilePath)
+
+	}
+
+	// Auto-ingest shared links: explicit URL entities are only acted on
+	// in private chats or via an explicit /dl command, so the bot
+	// doesn't try to download every link posted in a shared group.
+	if urls := extractURLs(update.Message); len(urls) > 0 && (update.Message.Chat.IsPrivate() || command == "dl") {
+		for _, dlURL := range urls {
+			responder, ok := dlRegistry.Match(dlURL)
+			if !ok {
 				continue
 			}
-			m.VoiceURL = f.Link(bot.Token)
-			m.FileExt = filepath.Ext(f.FilePath)
 
-		}
+			rc, filename, _, err := responder.Fetch(context.Background(), dlURL)
+			if err != nil {
+				slog.Error("Failed to download URL", "url", dlURL, "platform", responder.Name(), "error", err)
+				continue
+			}
 
-		if update.Message.Photo != nil {
-			slog.Info("Received a Photo Message", "Photo", update.Message.Photo)
-			f, err := bot.GetFile(telegram.FileConfig{FileID: update.Message.Photo[0].FileID})
+			path, err := uploadReaderToWs(context.Background(), gClient, rc, filepath.Ext(filename))
+			rc.Close()
 			if err != nil {
-				slog.Error("Failed to get Photo URL", "error", err)
+				slog.Error("Failed to upload downloaded media", "url", dlURL, "error", err)
 				continue
 			}
-			m.ImageURL = f.Link(bot.Token)
-			m.FileExt = filepath.Ext(f.FilePath)
 
+			m.Text = fmt.Sprintf("<INFO>This message contains a %s link which you can find in the workspace at %s</INFO>\n<MESSAGE>%s</MESSAGE>", responder.Name(), path, m.Text)
 		}
+	}
 
-		messageQueue <- m
+	payload, err := json.Marshal(m)
+	if err != nil {
+		slog.Error("Failed to marshal message", "error", err)
+		return
+	}
+	if err := mq.Enqueue(payload); err != nil {
+		slog.Error("Failed to enqueue message", "error", err)
+	}
+}
+
+// handleCallbackQuery enqueues a Message carrying an inline keyboard
+// button's CallbackData, and acknowledges the press with Telegram so the
+// client stops showing a loading spinner on the button.
+func handleCallbackQuery(bot *telegram.BotAPI, mq queue.Queue, authorizer *Authorizer, cb *telegram.CallbackQuery) {
+	var chatID int64
+	if cb.Message != nil {
+		chatID = cb.Message.Chat.ID
+	}
+	if !authorizer.Authorize(cb.From, chatID, "") {
+		slog.Warn("Unauthorized callback query", "userID", cb.From.ID, "userName", cb.From.UserName)
+		return
+	}
+
+	if cb.Message != nil {
+		m := Message{
+			ChatID:       fmt.Sprintf("%d", cb.Message.Chat.ID),
+			MsgID:        fmt.Sprintf("%d", cb.Message.MessageID),
+			User:         fmt.Sprintf("%s %s (%s)", cb.From.FirstName, cb.From.LastName, cb.From.UserName),
+			CallbackData: cb.Data,
+		}
+
+		payload, err := json.Marshal(m)
+		if err != nil {
+			slog.Error("Failed to marshal callback message", "error", err)
+		} else if err := mq.Enqueue(payload); err != nil {
+			slog.Error("Failed to enqueue callback message", "error", err)
+		}
+	}
 
+	if _, err := bot.Request(telegram.NewCallback(cb.ID, "")); err != nil {
+		slog.Error("Failed to answer callback query", "error", err)
 	}
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// mediaCache is a small in-memory, bounded-by-size cache for Telegram media
+// bytes keyed by FileID. Eviction is least-recently-used, tracked via a
+// doubly linked list so both lookups and evictions are O(1).
+type mediaCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type mediaCacheEntry struct {
+	key         string
+	data        []byte
+	contentType string
+}
+
+func newMediaCache(maxBytes int64) *mediaCache {
+	return &mediaCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *mediaCache) get(key string) ([]byte, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, "", false
+	}
+	c.ll.MoveToFront(el)
+	entry := el.Value.(*mediaCacheEntry)
+	return entry.data, entry.contentType, true
+}
+
+func (c *mediaCache) set(key string, data []byte, contentType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxBytes <= 0 || int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	if el, ok := c.items[key]; ok {
+		old := el.Value.(*mediaCacheEntry)
+		c.curBytes -= int64(len(old.data))
+		el.Value = &mediaCacheEntry{key: key, data: data, contentType: contentType}
+		c.ll.MoveToFront(el)
+		c.curBytes += int64(len(data))
+	} else {
+		el := c.ll.PushFront(&mediaCacheEntry{key: key, data: data, contentType: contentType})
+		c.items[key] = el
+		c.curBytes += int64(len(data))
+	}
+
+	for c.curBytes > c.maxBytes {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		c.evict(back)
+	}
+}
+
+func (c *mediaCache) evict(el *list.Element) {
+	entry := el.Value.(*mediaCacheEntry)
+	c.ll.Remove(el)
+	delete(c.items, entry.key)
+	c.curBytes -= int64(len(entry.data))
+}
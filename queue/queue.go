@@ -0,0 +1,214 @@
+// Package queue provides a durable, replay-safe message queue and a small
+// key/value state store backed by an embedded bbolt database, so the
+// bridge does not lose in-flight messages when obot is temporarily
+// unavailable and can resume cleanly after a restart.
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	messagesBucket = []byte("messages")
+	stateBucket    = []byte("state")
+)
+
+const offsetKey = "update_offset"
+
+// Redelivery backoff: a failing consumer must not be handed the same item
+// again on its very next poll, so each redelivery doubles the wait, up to
+// maxRedeliveryDelay.
+const (
+	baseRedeliveryDelay = 2 * time.Second
+	maxRedeliveryDelay  = 5 * time.Minute
+)
+
+func backoffDelay(attempts int) time.Duration {
+	d := baseRedeliveryDelay
+	for i := 0; i < attempts-1 && d < maxRedeliveryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRedeliveryDelay {
+		d = maxRedeliveryDelay
+	}
+	return d
+}
+
+// Item is a single durable queue entry.
+type Item struct {
+	ID       uint64
+	Payload  []byte
+	Attempts int
+}
+
+// Queue is a durable, at-least-once message queue: items stay pending
+// until explicitly acknowledged, so a crash between Dequeue and ack
+// redelivers them on restart instead of losing them.
+type Queue interface {
+	// Enqueue durably stores payload for later delivery.
+	Enqueue(payload []byte) error
+	// Dequeue returns up to max pending items in FIFO order, along with an
+	// ack func that must be called once they have been delivered
+	// successfully. Items left unacknowledged remain pending and are
+	// redelivered, with Attempts incremented, by the first Dequeue call
+	// after their exponential backoff delay has passed.
+	Dequeue(ctx context.Context, max int) (items []Item, ack func() error, err error)
+	// LastOffset returns the last persisted Telegram update offset, or 0 if
+	// none has been recorded yet.
+	LastOffset() (int, error)
+	// SetLastOffset persists the Telegram update offset to resume from on
+	// restart via telegram.NewUpdate(offset).
+	SetLastOffset(offset int) error
+	// Close releases the underlying database handle.
+	Close() error
+}
+
+// boltQueue is the default Queue implementation, backed by a single bbolt
+// file under the bot's data directory.
+type boltQueue struct {
+	db *bbolt.DB
+}
+
+// Open opens (creating if necessary) a durable queue at path.
+func Open(path string) (Queue, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue database %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(messagesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize queue database %q: %w", path, err)
+	}
+
+	return &boltQueue{db: db}, nil
+}
+
+func (q *boltQueue) Enqueue(payload []byte) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return b.Put(itemKey(id), encodeItem(payload, 0, time.Time{}))
+	})
+}
+
+func (q *boltQueue) Dequeue(ctx context.Context, max int) ([]Item, func() error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var items []Item
+	err := q.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil && len(items) < max; k, v = c.Next() {
+			payload, attempts, nextAttemptAt := decodeItem(v)
+			if nextAttemptAt.After(now) {
+				// Still backing off from a previous failed delivery; skip it
+				// but keep scanning so later, unrelated items aren't starved.
+				continue
+			}
+
+			// Bump the attempt counter and push the redelivery deadline out
+			// with exponential backoff immediately, so a crash before ack
+			// redelivers with backoff applied rather than retrying in a hot
+			// loop.
+			attempts++
+			items = append(items, Item{ID: binary.BigEndian.Uint64(k), Payload: payload, Attempts: attempts})
+
+			if err := b.Put(k, encodeItem(payload, attempts, now.Add(backoffDelay(attempts)))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ack := func() error {
+		return q.db.Update(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(messagesBucket)
+			for _, item := range items {
+				if err := b.Delete(itemKey(item.ID)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return items, ack, nil
+}
+
+func (q *boltQueue) LastOffset() (int, error) {
+	var offset int
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket(stateBucket).Get([]byte(offsetKey)); v != nil {
+			offset = int(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return offset, err
+}
+
+func (q *boltQueue) SetLastOffset(offset int) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(offset))
+		return tx.Bucket(stateBucket).Put([]byte(offsetKey), v)
+	})
+}
+
+func (q *boltQueue) Close() error {
+	return q.db.Close()
+}
+
+func itemKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+func encodeItem(payload []byte, attempts int, nextAttemptAt time.Time) []byte {
+	v := make([]byte, 12+len(payload))
+	binary.BigEndian.PutUint32(v[:4], uint32(attempts))
+	binary.BigEndian.PutUint64(v[4:12], uint64(nextAttemptAt.UnixNano()))
+	copy(v[12:], payload)
+	return v
+}
+
+func decodeItem(v []byte) ([]byte, int, time.Time) {
+	attempts := int(binary.BigEndian.Uint32(v[:4]))
+	nanos := int64(binary.BigEndian.Uint64(v[4:12]))
+	payload := make([]byte, len(v)-12)
+	copy(payload, v[12:])
+
+	// Never-yet-redelivered items are encoded with the zero Time, whose
+	// UnixNano overflows to a negative value, so nanos <= 0 decodes back to
+	// the zero Time and such items are always eligible for delivery.
+	var nextAttemptAt time.Time
+	if nanos > 0 {
+		nextAttemptAt = time.Unix(0, nanos)
+	}
+	return payload, attempts, nextAttemptAt
+}
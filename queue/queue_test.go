@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeItemRoundTrip(t *testing.T) {
+	want := time.Unix(0, time.Now().UnixNano())
+	v := encodeItem([]byte("hello"), 3, want)
+
+	payload, attempts, nextAttemptAt := decodeItem(v)
+	if string(payload) != "hello" {
+		t.Errorf("payload = %q, want %q", payload, "hello")
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+	if !nextAttemptAt.Equal(want) {
+		t.Errorf("nextAttemptAt = %v, want %v", nextAttemptAt, want)
+	}
+}
+
+func TestEncodeDecodeItemZeroNextAttempt(t *testing.T) {
+	v := encodeItem([]byte("hello"), 0, time.Time{})
+
+	_, _, nextAttemptAt := decodeItem(v)
+	if !nextAttemptAt.IsZero() {
+		t.Errorf("nextAttemptAt = %v, want zero", nextAttemptAt)
+	}
+}
+
+func openTestQueue(t *testing.T) Queue {
+	t.Helper()
+
+	q, err := Open(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := q.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	})
+	return q
+}
+
+func TestEnqueueDequeueAck(t *testing.T) {
+	q := openTestQueue(t)
+
+	if err := q.Enqueue([]byte("hello")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	items, ack, err := q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if len(items) != 1 || string(items[0].Payload) != "hello" {
+		t.Fatalf("Dequeue() = %+v, want one item with payload %q", items, "hello")
+	}
+	if items[0].Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", items[0].Attempts)
+	}
+
+	if err := ack(); err != nil {
+		t.Fatalf("ack() error = %v", err)
+	}
+
+	items, _, err = q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Dequeue() after ack error = %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("Dequeue() after ack = %+v, want no items", items)
+	}
+}
+
+func TestDequeueWithoutAckRedeliversWithBackoff(t *testing.T) {
+	q := openTestQueue(t)
+
+	if err := q.Enqueue([]byte("hello")); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	items, _, err := q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Dequeue() error = %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Dequeue() = %+v, want one item", items)
+	}
+
+	// Immediately re-dequeuing without ack must not redeliver: the item is
+	// still within its backoff window.
+	items, _, err = q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Dequeue() during backoff error = %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("Dequeue() during backoff = %+v, want no items", items)
+	}
+
+	time.Sleep(baseRedeliveryDelay + 100*time.Millisecond)
+
+	items, _, err = q.Dequeue(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Dequeue() after backoff error = %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Dequeue() after backoff = %+v, want one item", items)
+	}
+	if items[0].Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", items[0].Attempts)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ipRateLimiter hands out a token-bucket rate.Limiter per remote IP,
+// lazily creating one on first use. It is safe for concurrent use across
+// HTTP handlers.
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	r        rate.Limit
+	burst    int
+}
+
+// newIPRateLimiter builds a limiter store from a spec like "10-M", meaning
+// 10 requests per minute per IP, with the count also used as the burst
+// size. Supported periods are S(econd), M(inute), H(our) and D(ay).
+func newIPRateLimiter(spec string) (*ipRateLimiter, error) {
+	n, per, err := parseRateSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ipRateLimiter{
+		limiters: make(map[string]*rate.Limiter),
+		r:        rate.Every(per / time.Duration(n)),
+		burst:    n,
+	}, nil
+}
+
+func parseRateSpec(spec string) (int, time.Duration, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid rate limit spec %q, want e.g. 10-M", spec)
+	}
+
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit spec %q: bad count", spec)
+	}
+
+	var per time.Duration
+	switch strings.ToUpper(parts[1]) {
+	case "S":
+		per = time.Second
+	case "M":
+		per = time.Minute
+	case "H":
+		per = time.Hour
+	case "D":
+		per = 24 * time.Hour
+	default:
+		return 0, 0, fmt.Errorf("invalid rate limit spec %q: unknown period %q", spec, parts[1])
+	}
+
+	return n, per, nil
+}
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	lim, ok := l.limiters[ip]
+	if !ok {
+		lim = rate.NewLimiter(l.r, l.burst)
+		l.limiters[ip] = lim
+	}
+	l.mu.Unlock()
+
+	return lim.Allow()
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
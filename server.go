@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/activation"
+)
+
+// listen opens the TCP listener the HTTP server should serve on. When the
+// process was started under systemd socket activation (LISTEN_FDS set), the
+// pre-opened socket is reused instead of binding a new one, so the unit can
+// be configured to start the bot on first connection.
+func listen(addr string) (net.Listener, error) {
+	listeners, err := activation.Listeners()
+	if err == nil && len(listeners) > 0 {
+		return listeners[0], nil
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// idleShutdown calls onIdle once no activity has been reported for the
+// configured duration, to allow scale-to-zero deployments of the webhook
+// server. Call reset on every inbound request/update to keep it alive.
+type idleShutdown struct {
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func newIdleShutdown(d time.Duration, onIdle func()) *idleShutdown {
+	if d <= 0 {
+		return nil
+	}
+
+	return &idleShutdown{timer: time.AfterFunc(d, onIdle)}
+}
+
+func (i *idleShutdown) reset(d time.Duration) {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.timer.Reset(d)
+}